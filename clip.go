@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/lrstanley/go-ytdlp"
+)
+
+type ClipRequest struct {
+	URL     string `json:"url"`
+	StartMs int64  `json:"startMs"`
+	EndMs   int64  `json:"endMs"`
+	Format  string `json:"format,omitempty"`
+}
+
+// AudioFileMetadata is persisted as a JSON sidecar next to a clipped file so future
+// features (waveform preview, re-clipping) can reuse channel/sample-rate/frame info
+// without re-downloading the source.
+type AudioFileMetadata struct {
+	Channels   int   `json:"channels"`
+	SampleRate int   `json:"sampleRate"`
+	FrameCount int64 `json:"frameCount"`
+	DurationMs int64 `json:"durationMs"`
+}
+
+const (
+	clipSampleRate     = 48000
+	clipChannels       = 2
+	clipBytesPerSample = 2 // pcm_s16le
+)
+
+// clipResult describes a successfully clipped file, mirroring the fields processClip
+// needs to record a Track and build its FileInfo.
+type clipResult struct {
+	FilePath  string
+	Extractor string
+	SourceID  string
+	Title     string
+	Thumbnail string
+}
+
+// clipAudio pulls the bestaudio stream for url, decodes it to raw PCM, extracts the
+// sample range [startMs, endMs), and re-encodes the result to the requested format.
+func clipAudio(ctx context.Context, url string, startMs, endMs int64, format Format) (clipResult, error) {
+	if !isValidURL(url) {
+		return clipResult{}, fmt.Errorf("invalid URL: must be YouTube or SoundCloud")
+	}
+	if endMs <= startMs {
+		return clipResult{}, fmt.Errorf("endMs must be greater than startMs")
+	}
+
+	// fetch metadata, including duration so we can clamp the clip range
+	infoCmd := withNetworkOptions(ytdlp.New().DumpJSON())
+	metaResult, err := infoCmd.Run(ctx, url)
+	if err != nil {
+		return clipResult{}, fmt.Errorf("metadata fetch error: %w", err)
+	}
+
+	var info struct {
+		VideoInfo
+		Duration float64 `json:"duration"`
+	}
+	if err := json.Unmarshal([]byte(metaResult.Stdout), &info); err != nil {
+		return clipResult{}, fmt.Errorf("metadata parse error: %w", err)
+	}
+
+	durationMs := int64(info.Duration * 1000)
+	if durationMs > 0 && endMs > durationMs {
+		endMs = durationMs
+	}
+	if endMs <= startMs {
+		return clipResult{}, fmt.Errorf("startMs is beyond the media duration")
+	}
+
+	// pull the bestaudio stream as-is; decoding/trimming happens below via ffmpeg
+	srcFilename := fmt.Sprintf("clipsrc_%s", generateUniqueID())
+	dl := withNetworkOptions(ytdlp.New().Format("bestaudio").Output(srcFilename))
+	if _, err := dl.Run(ctx, url); err != nil {
+		return clipResult{}, fmt.Errorf("download error: %w", err)
+	}
+	defer os.Remove(srcFilename)
+
+	// decode the full source to raw PCM so we can seek/copy by sample offset
+	pcmFilename := srcFilename + ".pcm"
+	decodeCmd := exec.Command("ffmpeg", "-y", "-i", srcFilename,
+		"-f", "s16le", "-acodec", "pcm_s16le",
+		"-ar", fmt.Sprintf("%d", clipSampleRate), "-ac", fmt.Sprintf("%d", clipChannels),
+		pcmFilename)
+	if out, err := decodeCmd.CombinedOutput(); err != nil {
+		return clipResult{}, fmt.Errorf("ffmpeg decode error: %w (%s)", err, out)
+	}
+	defer os.Remove(pcmFilename)
+
+	pcm, err := os.Open(pcmFilename)
+	if err != nil {
+		return clipResult{}, fmt.Errorf("error opening decoded PCM: %w", err)
+	}
+	defer pcm.Close()
+
+	frameSize := int64(clipChannels * clipBytesPerSample)
+	startByte := (startMs * clipSampleRate / 1000) * frameSize
+	endByte := (endMs * clipSampleRate / 1000) * frameSize
+
+	if _, err := pcm.Seek(startByte, io.SeekStart); err != nil {
+		return clipResult{}, fmt.Errorf("error seeking PCM: %w", err)
+	}
+
+	trimmedFilename := srcFilename + ".trimmed.pcm"
+	trimmed, err := os.Create(trimmedFilename)
+	if err != nil {
+		return clipResult{}, fmt.Errorf("error creating trimmed PCM: %w", err)
+	}
+	defer os.Remove(trimmedFilename)
+
+	if _, err := io.CopyN(trimmed, pcm, endByte-startByte); err != nil && err != io.EOF {
+		trimmed.Close()
+		return clipResult{}, fmt.Errorf("error copying PCM samples: %w", err)
+	}
+	trimmed.Close()
+
+	fsFilename := fmt.Sprintf("%s - %s (clip).%s", safeFilename(info.Extractor), safeFilename(info.Title), format.Extension)
+	encodeArgs := []string{"-y",
+		"-f", "s16le", "-ar", fmt.Sprintf("%d", clipSampleRate), "-ac", fmt.Sprintf("%d", clipChannels),
+		"-i", trimmedFilename}
+	// ffmpeg picks the codec from the output extension, and .m4a defaults to AAC
+	if format.AudioFormat == "alac" {
+		encodeArgs = append(encodeArgs, "-c:a", "alac")
+	}
+	encodeArgs = append(encodeArgs, fsFilename)
+	encodeCmd := exec.Command("ffmpeg", encodeArgs...)
+	if out, err := encodeCmd.CombinedOutput(); err != nil {
+		return clipResult{}, fmt.Errorf("ffmpeg encode error: %w (%s)", err, out)
+	}
+
+	meta := AudioFileMetadata{
+		Channels:   clipChannels,
+		SampleRate: clipSampleRate,
+		FrameCount: (endByte - startByte) / frameSize,
+		DurationMs: endMs - startMs,
+	}
+	if err := writeMetadataSidecar(fsFilename, meta); err != nil {
+		log.Printf("[-] Error writing metadata sidecar for %s: %v", fsFilename, err)
+	}
+
+	return clipResult{
+		FilePath:  fsFilename,
+		Extractor: info.Extractor,
+		SourceID:  info.ID,
+		Title:     info.Title + " (clip)",
+		Thumbnail: info.Thumbnail,
+	}, nil
+}
+
+func writeMetadataSidecar(fsFilename string, meta AudioFileMetadata) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling metadata: %w", err)
+	}
+	return os.WriteFile(fsFilename+".meta.json", data, 0644)
+}
+
+// processClip runs clipAudio and streams the result over ch using the same SSE event
+// shapes as processURLs, so the frontend's existing /progress handling just works.
+// ctx is cancellable via DELETE /progress/<sessionID>, same as a /download job.
+func processClip(ctx context.Context, url string, startMs, endMs int64, format Format, sessionID string, ch chan string) {
+	defer close(ch)
+	defer sessionCancels.Delete(sessionID)
+
+	result, err := clipAudio(ctx, url, startMs, endMs, format)
+	if err != nil {
+		if ctx.Err() != nil {
+			emit(sessionID, ch, "event: error\ndata: {\"message\":\"job cancelled\"}\n\n")
+			emit(sessionID, ch, "event: done\ndata: {}\n\n")
+			if err := store.CompleteJob(sessionID); err != nil {
+				log.Printf("[-] Error completing job %s: %v", sessionID, err)
+			}
+			return
+		}
+		log.Printf("[-] Clip error for %s: %v", url, err)
+		emit(sessionID, ch, fmt.Sprintf("event: error\ndata: {\"url\":\"%s\",\"message\":\"%s\"}\n\n", url, err))
+		emit(sessionID, ch, "event: done\ndata: {}\n\n")
+		if err := store.CompleteJob(sessionID); err != nil {
+			log.Printf("[-] Error completing job %s: %v", sessionID, err)
+		}
+		return
+	}
+
+	size := int64(0)
+	if fi, statErr := os.Stat(result.FilePath); statErr == nil {
+		size = fi.Size()
+	}
+	track := Track{
+		ID:        generateUniqueID(),
+		JobID:     sessionID,
+		SourceURL: url,
+		Extractor: result.Extractor,
+		SourceID:  result.SourceID,
+		Title:     result.Title,
+		Thumbnail: result.Thumbnail,
+		Format:    format.Code,
+		FilePath:  result.FilePath,
+		SizeBytes: size,
+	}
+	if err := store.InsertTrack(track); err != nil {
+		log.Printf("[-] Error recording track: %v", err)
+	}
+
+	downloadUrl := ""
+	if token, err := issueDownloadToken(track.ID, defaultTokenTTL, 0); err != nil {
+		log.Printf("[-] Error issuing download token for %s: %v", track.ID, err)
+	} else {
+		downloadUrl = fmt.Sprintf("/file/%s", token)
+	}
+
+	fileInfo := FileInfo{
+		Title:       fmt.Sprintf("%s - %s.%s", track.Extractor, track.Title, format.Extension),
+		Extractor:   track.Extractor,
+		Thumbnail:   track.Thumbnail,
+		DownloadUrl: downloadUrl,
+		Format:      format.Code,
+	}
+	if fileJSON, err := json.Marshal(fileInfo); err != nil {
+		log.Printf("[-] Error marshaling file info: %v", err)
+	} else {
+		emit(sessionID, ch, fmt.Sprintf("event: file\ndata: %s\n\n", fileJSON))
+	}
+
+	emit(sessionID, ch, "event: done\ndata: {}\n\n")
+	if err := store.CompleteJob(sessionID); err != nil {
+		log.Printf("[-] Error completing job %s: %v", sessionID, err)
+	}
+
+	// cleanup clip file and its metadata sidecar after cfg.CleanupTTLSeconds
+	go func(f string) {
+		time.Sleep(time.Duration(cfg.CleanupTTLSeconds) * time.Second)
+		if err := os.Remove(f); err != nil {
+			log.Printf("[-] Error cleaning up file %s: %v", f, err)
+		}
+		if err := os.Remove(f + ".meta.json"); err != nil {
+			log.Printf("[-] Error cleaning up metadata sidecar for %s: %v", f, err)
+		}
+	}(result.FilePath)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Config holds GoMP3's runtime configuration. It's loaded once at startup from a JSON
+// file (conf.json by default) with GOMP3_* environment variables layered on top.
+type Config struct {
+	BindAddr               string   `json:"bindAddr"`
+	CORSOrigin             string   `json:"corsOrigin"`
+	WorkDir                string   `json:"workDir"`
+	CleanupTTLSeconds      int      `json:"cleanupTtlSeconds"`
+	MaxConcurrentDownloads int      `json:"maxConcurrentDownloads"` // per session
+	MaxURLsPerRequest      int      `json:"maxUrlsPerRequest"`
+	AllowedHosts           []string `json:"allowedHosts"`
+	DefaultFormat          string   `json:"defaultFormat"`
+	DefaultBitrate         string   `json:"defaultBitrate"`
+	CookiesFromBrowser     string   `json:"cookiesFromBrowser"`
+	Proxy                  string   `json:"proxy"`
+	RateLimit              string   `json:"rateLimit"`
+	TokenSecret            string   `json:"tokenSecret"` // hex-encoded HMAC secret for download tokens; generated at startup if empty
+}
+
+func defaultConfig() Config {
+	return Config{
+		BindAddr:               "0.0.0.0:4444",
+		CORSOrigin:             "http://localhost:4444",
+		WorkDir:                ".",
+		CleanupTTLSeconds:      300,
+		MaxConcurrentDownloads: 3,
+		MaxURLsPerRequest:      25,
+		AllowedHosts: []string{
+			"https://www.youtube.com/",
+			"https://youtu.be/",
+			"https://soundcloud.com/",
+			"https://on.soundcloud.com/",
+		},
+		DefaultFormat: "mp3",
+	}
+}
+
+// loadConfig starts from defaultConfig, overlays path's JSON if the file exists, then
+// applies GOMP3_* environment variable overrides. A missing file is fine (defaults
+// apply); a present-but-malformed file is a hard error so main() can refuse to start.
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return Config{}, fmt.Errorf("error parsing config file %s: %w", path, err)
+		}
+	case os.IsNotExist(err):
+		// no config file -> defaults (plus env overrides) apply
+	default:
+		return Config{}, fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+
+	applyEnvOverrides(&cfg)
+	return cfg, nil
+}
+
+func applyEnvOverrides(cfg *Config) {
+	if v := os.Getenv("GOMP3_PORT"); v != "" {
+		cfg.BindAddr = "0.0.0.0:" + v
+	}
+	if v := os.Getenv("GOMP3_BIND_ADDR"); v != "" {
+		cfg.BindAddr = v
+	}
+	if v := os.Getenv("GOMP3_CORS_ORIGIN"); v != "" {
+		cfg.CORSOrigin = v
+	}
+	if v := os.Getenv("GOMP3_WORK_DIR"); v != "" {
+		cfg.WorkDir = v
+	}
+	if v := os.Getenv("GOMP3_CLEANUP_TTL_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.CleanupTTLSeconds = n
+		}
+	}
+	if v := os.Getenv("GOMP3_MAX_CONCURRENT_DOWNLOADS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.MaxConcurrentDownloads = n
+		}
+	}
+	if v := os.Getenv("GOMP3_MAX_URLS_PER_REQUEST"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.MaxURLsPerRequest = n
+		}
+	}
+	if v := os.Getenv("GOMP3_DEFAULT_FORMAT"); v != "" {
+		cfg.DefaultFormat = v
+	}
+	if v := os.Getenv("GOMP3_DEFAULT_BITRATE"); v != "" {
+		cfg.DefaultBitrate = v
+	}
+	if v := os.Getenv("GOMP3_COOKIES_FROM_BROWSER"); v != "" {
+		cfg.CookiesFromBrowser = v
+	}
+	if v := os.Getenv("GOMP3_PROXY"); v != "" {
+		cfg.Proxy = v
+	}
+	if v := os.Getenv("GOMP3_RATE_LIMIT"); v != "" {
+		cfg.RateLimit = v
+	}
+	if v := os.Getenv("GOMP3_TOKEN_SECRET"); v != "" {
+		cfg.TokenSecret = v
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig_MissingFileUsesDefaults(t *testing.T) {
+	cfg, err := loadConfig(filepath.Join(t.TempDir(), "does-not-exist.json"))
+	if err != nil {
+		t.Fatalf("loadConfig returned error for missing file: %v", err)
+	}
+
+	want := defaultConfig()
+	if cfg.BindAddr != want.BindAddr || cfg.DefaultFormat != want.DefaultFormat || cfg.MaxURLsPerRequest != want.MaxURLsPerRequest {
+		t.Fatalf("loadConfig() = %+v, want defaults %+v", cfg, want)
+	}
+}
+
+func TestLoadConfig_FileOverridesDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conf.json")
+	if err := os.WriteFile(path, []byte(`{"bindAddr":"127.0.0.1:9000","defaultFormat":"flac"}`), 0644); err != nil {
+		t.Fatalf("error writing test config: %v", err)
+	}
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig returned error: %v", err)
+	}
+	if cfg.BindAddr != "127.0.0.1:9000" {
+		t.Errorf("BindAddr = %q, want %q", cfg.BindAddr, "127.0.0.1:9000")
+	}
+	if cfg.DefaultFormat != "flac" {
+		t.Errorf("DefaultFormat = %q, want %q", cfg.DefaultFormat, "flac")
+	}
+	// Fields absent from the file should still fall back to defaults.
+	if cfg.MaxURLsPerRequest != defaultConfig().MaxURLsPerRequest {
+		t.Errorf("MaxURLsPerRequest = %d, want default %d", cfg.MaxURLsPerRequest, defaultConfig().MaxURLsPerRequest)
+	}
+}
+
+func TestLoadConfig_MalformedFileIsHardError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conf.json")
+	if err := os.WriteFile(path, []byte(`{not valid json`), 0644); err != nil {
+		t.Fatalf("error writing test config: %v", err)
+	}
+
+	if _, err := loadConfig(path); err == nil {
+		t.Fatal("loadConfig() on malformed file: want error, got nil")
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	for _, env := range []string{
+		"GOMP3_PORT", "GOMP3_BIND_ADDR", "GOMP3_CORS_ORIGIN", "GOMP3_WORK_DIR",
+		"GOMP3_CLEANUP_TTL_SECONDS", "GOMP3_MAX_CONCURRENT_DOWNLOADS", "GOMP3_MAX_URLS_PER_REQUEST",
+		"GOMP3_DEFAULT_FORMAT", "GOMP3_DEFAULT_BITRATE", "GOMP3_COOKIES_FROM_BROWSER",
+		"GOMP3_PROXY", "GOMP3_RATE_LIMIT", "GOMP3_TOKEN_SECRET",
+	} {
+		t.Setenv(env, "")
+		os.Unsetenv(env)
+	}
+
+	t.Setenv("GOMP3_PORT", "8080")
+	t.Setenv("GOMP3_CORS_ORIGIN", "https://example.com")
+	t.Setenv("GOMP3_CLEANUP_TTL_SECONDS", "60")
+	t.Setenv("GOMP3_MAX_CONCURRENT_DOWNLOADS", "not-a-number")
+	t.Setenv("GOMP3_DEFAULT_FORMAT", "wav")
+
+	cfg := defaultConfig()
+	applyEnvOverrides(&cfg)
+
+	if cfg.BindAddr != "0.0.0.0:8080" {
+		t.Errorf("BindAddr = %q, want %q", cfg.BindAddr, "0.0.0.0:8080")
+	}
+	if cfg.CORSOrigin != "https://example.com" {
+		t.Errorf("CORSOrigin = %q, want %q", cfg.CORSOrigin, "https://example.com")
+	}
+	if cfg.CleanupTTLSeconds != 60 {
+		t.Errorf("CleanupTTLSeconds = %d, want 60", cfg.CleanupTTLSeconds)
+	}
+	// An unparsable int override is ignored, leaving the default in place.
+	if cfg.MaxConcurrentDownloads != defaultConfig().MaxConcurrentDownloads {
+		t.Errorf("MaxConcurrentDownloads = %d, want default %d left untouched by a bad override",
+			cfg.MaxConcurrentDownloads, defaultConfig().MaxConcurrentDownloads)
+	}
+	if cfg.DefaultFormat != "wav" {
+		t.Errorf("DefaultFormat = %q, want %q", cfg.DefaultFormat, "wav")
+	}
+}
+
+func TestApplyEnvOverrides_BindAddrTakesPrecedenceOverPort(t *testing.T) {
+	t.Setenv("GOMP3_PORT", "8080")
+	t.Setenv("GOMP3_BIND_ADDR", "127.0.0.1:9090")
+
+	cfg := defaultConfig()
+	applyEnvOverrides(&cfg)
+
+	if cfg.BindAddr != "127.0.0.1:9090" {
+		t.Errorf("BindAddr = %q, want GOMP3_BIND_ADDR to win: %q", cfg.BindAddr, "127.0.0.1:9090")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import "fmt"
+
+// Format describes one of the output audio formats the download pipeline can produce.
+type Format struct {
+	Code              string // code accepted in the URLRequest JSON, e.g. "flac"
+	Extension         string // filesystem/download extension, without the dot
+	ContentType       string // Content-Type header for the /file/... handler
+	AudioFormat       string // value passed to ytdlp's AudioFormat()
+	PostprocessorArgs string // extra ffmpeg args forwarded via PostprocessorArgs(), if any
+}
+
+// formats is the registry of supported output formats, keyed by Format.Code.
+var formats = map[string]Format{
+	"mp3":  {Code: "mp3", Extension: "mp3", ContentType: "audio/mpeg", AudioFormat: "mp3"},
+	"flac": {Code: "flac", Extension: "flac", ContentType: "audio/flac", AudioFormat: "flac"},
+	"alac": {Code: "alac", Extension: "m4a", ContentType: "audio/mp4", AudioFormat: "alac"},
+	"opus": {Code: "opus", Extension: "opus", ContentType: "audio/ogg", AudioFormat: "opus"},
+	"aac":  {Code: "aac", Extension: "aac", ContentType: "audio/aac", AudioFormat: "aac"},
+	"wav":  {Code: "wav", Extension: "wav", ContentType: "audio/wav", AudioFormat: "wav"},
+}
+
+// lookupFormat resolves a user-supplied format code from the registry, defaulting to
+// cfg.DefaultFormat when code is empty so existing clients that don't send a format
+// keep working unchanged.
+func lookupFormat(code string) (Format, error) {
+	if code == "" {
+		code = cfg.DefaultFormat
+	}
+	f, ok := formats[code]
+	if !ok {
+		return Format{}, fmt.Errorf("unsupported format: %s", code)
+	}
+	return f, nil
+}
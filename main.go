@@ -7,12 +7,14 @@ import (
 	"crypto/rand"
 	"embed"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -24,10 +26,14 @@ import (
 var content embed.FS
 
 type URLRequest struct {
-	URLs []string `json:"urls"`
+	URLs    []string `json:"urls"`
+	Format  string   `json:"format,omitempty"`  // output format code, e.g. "flac"; defaults to cfg.DefaultFormat
+	Quality string   `json:"quality,omitempty"` // optional ytdlp audio quality, e.g. "0" or "192K"
+	Bitrate string   `json:"bitrate,omitempty"` // optional explicit bitrate, e.g. "320k"
 }
 
 type VideoInfo struct {
+	ID        string `json:"id"`
 	Title     string `json:"title"`
 	Extractor string `json:"extractor"`
 	Thumbnail string `json:"thumbnail"`
@@ -38,19 +44,39 @@ type FileInfo struct {
 	Extractor   string `json:"extractor"`
 	Thumbnail   string `json:"thumbnail"`
 	DownloadUrl string `json:"downloadUrl"`
+	Format      string `json:"format"`
 }
 
 type SessionResponse struct {
 	SessionID string `json:"sessionId"`
 }
 
-var sessions sync.Map
+// liveSessions holds the SSE channel for jobs currently being processed, keyed by
+// session ID. Job/track history itself lives in store, so a reconnecting client can
+// replay past events even after its entry here is gone.
+var liveSessions sync.Map
+
+// sessionCancels holds the cancel func for each job currently being processed, keyed
+// by session ID, so DELETE /progress/<sessionID> can abort it mid-flight.
+var sessionCancels sync.Map
+
+var store *Store
+
+// objectStorage is where completed track/zip files are written. s3Backend is set
+// alongside it (to the same value) whenever S3 is active, since the bulk zip-streaming
+// path needs S3-specific operations beyond the Storage interface.
+var objectStorage Storage = newLocalStorage()
+var s3Backend *s3Storage
+
+var cfg Config
 
 func isValidURL(url string) bool {
-	return strings.HasPrefix(url, "https://www.youtube.com/") ||
-		strings.HasPrefix(url, "https://youtu.be/") ||
-		strings.HasPrefix(url, "https://soundcloud.com/") ||
-		strings.HasPrefix(url, "https://on.soundcloud.com/")
+	for _, host := range cfg.AllowedHosts {
+		if strings.HasPrefix(url, host) {
+			return true
+		}
+	}
+	return false
 }
 
 func generateUniqueID() string {
@@ -72,46 +98,115 @@ func safeFilename(title string) string {
 	return title
 }
 
-// downloads audio and returns filesystem-safe filename, display name, thumbnail
-func downloadAudio(url string) (string, string, string, error) {
-	if !isValidURL(url) {
-		return "", "", "", fmt.Errorf("invalid URL: must be YouTube or SoundCloud")
+// withNetworkOptions applies the configured cookies-from-browser/proxy/rate-limit
+// flags to a yt-dlp command builder, so every invocation (metadata or download) honors
+// the same network configuration.
+func withNetworkOptions(cmd *ytdlp.Command) *ytdlp.Command {
+	if cfg.CookiesFromBrowser != "" {
+		cmd = cmd.CookiesFromBrowser(cfg.CookiesFromBrowser)
+	}
+	if cfg.Proxy != "" {
+		cmd = cmd.Proxy(cfg.Proxy)
 	}
+	if cfg.RateLimit != "" {
+		cmd = cmd.LimitRate(cfg.RateLimit)
+	}
+	return cmd
+}
 
-	// fetch metadata
-	infoCmd := ytdlp.New().DumpJSON()
-	metaResult, err := infoCmd.Run(context.TODO(), url)
+// fetchVideoInfo resolves a URL's metadata via yt-dlp, ahead of any decision about
+// whether a download is actually needed (e.g. dedup against the store).
+func fetchVideoInfo(ctx context.Context, url string) (VideoInfo, error) {
+	infoCmd := withNetworkOptions(ytdlp.New().DumpJSON())
+	metaResult, err := infoCmd.Run(ctx, url)
 	if err != nil {
-		return "", "", "", fmt.Errorf("metadata fetch error: %w", err)
+		return VideoInfo{}, fmt.Errorf("metadata fetch error: %w", err)
 	}
 
 	var info VideoInfo
 	if err := json.Unmarshal([]byte(metaResult.Stdout), &info); err != nil {
-		return "", "", "", fmt.Errorf("metadata parse error: %w", err)
+		return VideoInfo{}, fmt.Errorf("metadata parse error: %w", err)
+	}
+	return info, nil
+}
+
+// PlaylistEntry is one item inside a playlist/channel/album's flat-playlist listing.
+type PlaylistEntry struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// PlaylistInfo is yt-dlp's flat-playlist JSON shape: a collection of entries rather
+// than a single track.
+type PlaylistInfo struct {
+	Type    string          `json:"_type"`
+	Title   string          `json:"title"`
+	Entries []PlaylistEntry `json:"entries"`
+}
+
+// expandPlaylist resolves url via yt-dlp's flat-playlist mode. If url turns out to be
+// a playlist/channel/album, ok is true and info.Entries holds its individual tracks;
+// otherwise ok is false and the caller should treat url as a single track.
+func expandPlaylist(ctx context.Context, url string) (PlaylistInfo, bool, error) {
+	infoCmd := withNetworkOptions(ytdlp.New().FlatPlaylist().DumpSingleJSON())
+	result, err := infoCmd.Run(ctx, url)
+	if err != nil {
+		return PlaylistInfo{}, false, fmt.Errorf("playlist metadata fetch error: %w", err)
+	}
+
+	var info PlaylistInfo
+	if err := json.Unmarshal([]byte(result.Stdout), &info); err != nil {
+		return PlaylistInfo{}, false, fmt.Errorf("playlist metadata parse error: %w", err)
+	}
+	if info.Type != "playlist" || len(info.Entries) == 0 {
+		return PlaylistInfo{}, false, nil
+	}
+	return info, true, nil
+}
+
+// downloads audio for an already-resolved video and returns the filesystem-safe
+// filename and display name.
+func downloadAudio(ctx context.Context, url string, info VideoInfo, format Format, quality, bitrate string) (string, string, error) {
+	if !isValidURL(url) {
+		return "", "", fmt.Errorf("invalid URL: must be YouTube or SoundCloud")
 	}
 
 	// filesystem-safe filename
-	fsFilename := fmt.Sprintf("%s - %s.mp3", safeFilename(info.Extractor), safeFilename(info.Title))
+	fsFilename := fmt.Sprintf("%s - %s.%s", safeFilename(info.Extractor), safeFilename(info.Title), format.Extension)
 
 	// download audio
 	dl := ytdlp.New().
 		ExtractAudio().
-		AudioFormat("mp3").
+		AudioFormat(format.AudioFormat).
 		EmbedMetadata().
 		EmbedThumbnail().
 		Output(fsFilename)
 
-	if _, err := dl.Run(context.TODO(), url); err != nil {
-		return "", "", "", fmt.Errorf("download error: %w", err)
+	if quality != "" {
+		dl = dl.AudioQuality(quality)
+	}
+	if bitrate == "" {
+		bitrate = cfg.DefaultBitrate
+	}
+	if bitrate != "" {
+		dl = dl.PostProcessorArgs(fmt.Sprintf("ffmpeg:-b:a %s", bitrate))
+	} else if format.PostprocessorArgs != "" {
+		dl = dl.PostProcessorArgs(fmt.Sprintf("ffmpeg:%s", format.PostprocessorArgs))
+	}
+
+	dl = withNetworkOptions(dl)
+
+	if _, err := dl.Run(ctx, url); err != nil {
+		return "", "", fmt.Errorf("download error: %w", err)
 	}
 
 	// verify file exists
 	if _, err := os.Stat(fsFilename); os.IsNotExist(err) {
-		return "", "", "", fmt.Errorf("output file not found: %s", fsFilename)
+		return "", "", fmt.Errorf("output file not found: %s", fsFilename)
 	}
 
-	displayName := fmt.Sprintf("%s - %s.mp3", info.Extractor, info.Title)
-	return fsFilename, displayName, info.Thumbnail, nil
+	displayName := fmt.Sprintf("%s - %s.%s", info.Extractor, info.Title, format.Extension)
+	return fsFilename, displayName, nil
 }
 
 // creates a ZIP archive of multiple files
@@ -148,91 +243,274 @@ func createZipFile(filenames []string) (string, error) {
 	return zipFilename, nil
 }
 
-func processURLs(urls []string, ch chan string) {
-	var filenames []string
-	var fileInfos []FileInfo
+// publishToS3 uploads a freshly-downloaded local file to the active S3 backend, deletes
+// the local copy, and repoints track at the S3 object key. Left as local on any error,
+// so the caller still serves the file from disk.
+func publishToS3(track *Track) error {
+	f, err := os.Open(track.FilePath)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", track.FilePath, err)
+	}
+	defer f.Close()
 
-	for _, url := range urls {
-		log.Printf("Processing: %s", url)
-		fsFilename, displayName, thumbnail, err := downloadAudio(url)
+	key := filepath.Base(track.FilePath)
+	if err := s3Backend.Put(context.TODO(), key, f); err != nil {
+		return err
+	}
+	if err := os.Remove(track.FilePath); err != nil {
+		log.Printf("[-] Error removing local copy of %s after S3 upload: %v", track.FilePath, err)
+	}
+
+	track.FilePath = key
+	track.Backend = "s3"
+	return nil
+}
+
+// emit sends payload to the live SSE channel and records it in the store so a
+// reconnecting client can replay it later.
+func emit(sessionID string, ch chan string, payload string) {
+	ch <- payload
+	if err := store.AppendEvent(sessionID, payload); err != nil {
+		log.Printf("[-] Error recording event for session %s: %v", sessionID, err)
+	}
+}
+
+// processOneURL resolves a single track URL (download or reuse a completed one) and
+// emits its event: file payload. localFilenames/s3Keys/freshFilenames are shared across worker
+// goroutines and protected by mu.
+func processOneURL(ctx context.Context, url string, format Format, quality, bitrate, sessionID string, ch chan string, mu *sync.Mutex, localFilenames, s3Keys, freshFilenames *[]string, maxDownloads int) {
+	log.Printf("Processing: %s", url)
+
+	if !isValidURL(url) {
+		err := fmt.Errorf("invalid URL: must be YouTube or SoundCloud")
+		log.Printf("[-] Rejected URL %s: %v", url, err)
+		emit(sessionID, ch, fmt.Sprintf("event: error\ndata: {\"url\":\"%s\",\"message\":\"%s\"}\n\n", url, err))
+		return
+	}
+
+	info, err := fetchVideoInfo(ctx, url)
+	if err != nil {
+		log.Printf("[-] Metadata error for %s: %v", url, err)
+		emit(sessionID, ch, fmt.Sprintf("event: error\ndata: {\"url\":\"%s\",\"message\":\"%s\"}\n\n", url, err))
+		return
+	}
+
+	track, err := store.FindCompletedTrack(info.Extractor, info.ID, format.Code)
+	if err != nil {
+		log.Printf("[-] Error checking existing tracks: %v", err)
+	}
+	if track != nil && track.Backend == "local" {
+		if _, statErr := os.Stat(track.FilePath); statErr != nil {
+			track = nil // file was cleaned up, fall through to a fresh download
+		}
+	}
+
+	if track == nil {
+		fsFilename, _, err := downloadAudio(ctx, url, info, format, quality, bitrate)
 		if err != nil {
 			log.Printf("[-] Download error for %s: %v", url, err)
-			ch <- fmt.Sprintf("event: error\ndata: {\"url\":\"%s\",\"message\":\"%s\"}\n\n", url, err)
-			continue
+			emit(sessionID, ch, fmt.Sprintf("event: error\ndata: {\"url\":\"%s\",\"message\":\"%s\"}\n\n", url, err))
+			return
 		}
-		filenames = append(filenames, fsFilename)
-		fileId := generateUniqueID()
-		downloadUrl := fmt.Sprintf("/file/%s", fileId)
 
-		http.HandleFunc(downloadUrl, func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "http://localhost:4444")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-			if r.Method == http.MethodOptions {
-				w.WriteHeader(http.StatusOK)
-				return
-			}
-			file, err := os.Open(fsFilename)
-			if err != nil {
-				http.Error(w, "error opening file", http.StatusInternalServerError)
-				log.Printf("[-] Error opening file %s: %v", fsFilename, err)
-				return
-			}
-			defer file.Close()
-			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", displayName))
-			w.Header().Set("Content-Type", "audio/mpeg")
-			if _, err := io.Copy(w, file); err != nil {
-				log.Printf("[-] Error streaming file %s: %v", fsFilename, err)
+		size := int64(0)
+		if fi, statErr := os.Stat(fsFilename); statErr == nil {
+			size = fi.Size()
+		}
+		track = &Track{
+			ID:        generateUniqueID(),
+			JobID:     sessionID,
+			SourceURL: url,
+			Extractor: info.Extractor,
+			SourceID:  info.ID,
+			Title:     info.Title,
+			Thumbnail: info.Thumbnail,
+			Format:    format.Code,
+			FilePath:  fsFilename,
+			Backend:   "local",
+			SizeBytes: size,
+		}
+
+		if s3Backend != nil {
+			if err := publishToS3(track); err != nil {
+				log.Printf("[-] Error publishing %s to S3: %v", fsFilename, err)
 			}
-		})
+		}
 
-		fileInfo := FileInfo{
-			Title:       displayName,
-			Extractor:   strings.Split(displayName, " - ")[0],
-			Thumbnail:   thumbnail,
-			DownloadUrl: downloadUrl,
+		if err := store.InsertTrack(*track); err != nil {
+			log.Printf("[-] Error recording track: %v", err)
 		}
-		fileInfos = append(fileInfos, fileInfo)
+		if track.Backend == "local" {
+			mu.Lock()
+			*freshFilenames = append(*freshFilenames, fsFilename)
+			mu.Unlock()
+		}
+	} else {
+		log.Printf("Reusing existing download for %s", url)
+	}
+
+	mu.Lock()
+	if track.Backend == "s3" {
+		*s3Keys = append(*s3Keys, track.FilePath)
+	} else {
+		*localFilenames = append(*localFilenames, track.FilePath)
+	}
+	mu.Unlock()
 
-		fileJSON, err := json.Marshal(fileInfo)
+	var downloadUrl string
+	if track.Backend == "s3" {
+		presigned, err := objectStorage.PresignedGetURL(ctx, track.FilePath, defaultPresignTTL)
 		if err != nil {
-			log.Printf("[-] Error marshaling file info: %v", err)
-			continue
+			log.Printf("[-] Error presigning %s: %v", track.FilePath, err)
+			return
+		}
+		downloadUrl = presigned
+	} else {
+		token, err := issueDownloadToken(track.ID, defaultTokenTTL, maxDownloads)
+		if err != nil {
+			log.Printf("[-] Error issuing download token for %s: %v", track.ID, err)
+			return
 		}
-		ch <- fmt.Sprintf("event: file\ndata: %s\n\n", fileJSON)
+		downloadUrl = fmt.Sprintf("/file/%s", token)
+	}
+
+	fileInfo := FileInfo{
+		Title:       fmt.Sprintf("%s - %s.%s", track.Extractor, track.Title, format.Extension),
+		Extractor:   track.Extractor,
+		Thumbnail:   track.Thumbnail,
+		DownloadUrl: downloadUrl,
+		Format:      track.Format,
+	}
+
+	fileJSON, err := json.Marshal(fileInfo)
+	if err != nil {
+		log.Printf("[-] Error marshaling file info: %v", err)
+		return
 	}
+	emit(sessionID, ch, fmt.Sprintf("event: file\ndata: %s\n\n", fileJSON))
+}
 
-	var zipUrl string
-	if len(filenames) > 1 {
-		zipFilename, err := createZipFile(filenames)
+// processURLs expands any playlist/channel/album URLs into their individual tracks,
+// then fans the resulting work out across a bounded worker pool (size from
+// cfg.MaxConcurrentDownloads) so one slow or broken track never blocks its siblings.
+func processURLs(ctx context.Context, urls []string, format Format, quality, bitrate, sessionID string, ch chan string, maxDownloads int) {
+	var expanded []string
+	for _, url := range urls {
+		if !isValidURL(url) {
+			err := fmt.Errorf("invalid URL: must be YouTube or SoundCloud")
+			log.Printf("[-] Rejected URL %s: %v", url, err)
+			emit(sessionID, ch, fmt.Sprintf("event: error\ndata: {\"url\":\"%s\",\"message\":\"%s\"}\n\n", url, err))
+			continue
+		}
+
+		info, isPlaylist, err := expandPlaylist(ctx, url)
 		if err != nil {
+			log.Printf("[-] Playlist check error for %s: %v", url, err)
+		}
+		if isPlaylist {
+			emit(sessionID, ch, fmt.Sprintf("event: playlist\ndata: {\"url\":\"%s\",\"count\":%d,\"title\":\"%s\"}\n\n",
+				url, len(info.Entries), info.Title))
+			for _, entry := range info.Entries {
+				expanded = append(expanded, entry.URL)
+			}
+		} else {
+			expanded = append(expanded, url)
+		}
+	}
+
+	workers := cfg.MaxConcurrentDownloads
+	if workers <= 0 {
+		workers = 3
+	}
+
+	var mu sync.Mutex
+	var localFilenames []string
+	var s3Keys []string
+	var freshFilenames []string
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for url := range jobs {
+				processOneURL(ctx, url, format, quality, bitrate, sessionID, ch, &mu, &localFilenames, &s3Keys, &freshFilenames, maxDownloads)
+			}
+		}()
+	}
+
+feedJobs:
+	for _, url := range expanded {
+		select {
+		case jobs <- url:
+		case <-ctx.Done():
+			break feedJobs
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		emit(sessionID, ch, "event: error\ndata: {\"message\":\"job cancelled\"}\n\n")
+		emit(sessionID, ch, "event: done\ndata: {}\n\n")
+		close(ch)
+		sessionCancels.Delete(sessionID)
+		if err := store.CompleteJob(sessionID); err != nil {
+			log.Printf("[-] Error completing job %s: %v", sessionID, err)
+		}
+		return
+	}
+
+	// Tracks that failed to publish to S3 (publishToS3 error, logged above) stay on
+	// local disk even when s3Backend is active, so s3Keys and localFilenames are
+	// zipped separately rather than assuming every track shares one backend.
+	if len(s3Keys) > 1 {
+		zipKey := fmt.Sprintf("songs_%s.zip", generateUniqueID())
+		if err := s3Backend.zipToS3(ctx, s3Keys, zipKey); err != nil {
+			log.Printf("[-] Error creating ZIP in S3: %v", err)
+		} else {
+			zipUrl, err := s3Backend.PresignedGetURL(ctx, zipKey, defaultPresignTTL)
+			if err != nil {
+				log.Printf("[-] Error presigning ZIP %s: %v", zipKey, err)
+			} else {
+				emit(sessionID, ch, fmt.Sprintf("event: zip\ndata: \"%s\"\n\n", zipUrl))
+			}
+		}
+	}
+
+	if len(localFilenames) > 1 {
+		if zipFilename, err := createZipFile(localFilenames); err != nil {
 			log.Printf("[-] Error creating ZIP: %v", err)
 		} else {
-			zipUrl = fmt.Sprintf("/zip/%s", generateUniqueID())
-			http.HandleFunc(zipUrl, func(w http.ResponseWriter, r *http.Request) {
-				w.Header().Set("Access-Control-Allow-Origin", "http://localhost:4444")
-				w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-				if r.Method == http.MethodOptions {
-					w.WriteHeader(http.StatusOK)
-					return
-				}
-				file, err := os.Open(zipFilename)
-				if err != nil {
-					http.Error(w, "error opening ZIP file", http.StatusInternalServerError)
-					log.Printf("[-] Error opening ZIP %s: %v", zipFilename, err)
-					return
-				}
-				defer file.Close()
-				w.Header().Set("Content-Disposition", "attachment; filename=\"songs.zip\"")
-				w.Header().Set("Content-Type", "application/zip")
-				if _, err := io.Copy(w, file); err != nil {
-					log.Printf("[-] Error streaming ZIP %s: %v", zipFilename, err)
-				}
-			})
-			ch <- fmt.Sprintf("event: zip\ndata: \"%s\"\n\n", zipUrl)
+			zipTrack := Track{
+				ID:        generateUniqueID(),
+				JobID:     sessionID,
+				SourceURL: "",
+				Extractor: "zip",
+				SourceID:  generateUniqueID(),
+				Title:     "songs",
+				Format:    "zip",
+				FilePath:  zipFilename,
+				Backend:   "local",
+			}
+			if fi, statErr := os.Stat(zipFilename); statErr == nil {
+				zipTrack.SizeBytes = fi.Size()
+			}
+			if err := store.InsertTrack(zipTrack); err != nil {
+				log.Printf("[-] Error recording zip track: %v", err)
+			}
+
+			token, err := issueDownloadToken(zipTrack.ID, defaultTokenTTL, maxDownloads)
+			if err != nil {
+				log.Printf("[-] Error issuing download token for zip %s: %v", zipTrack.ID, err)
+			} else {
+				emit(sessionID, ch, fmt.Sprintf("event: zip\ndata: \"/file/%s\"\n\n", token))
+			}
 
-			// cleanup ZIP file after 5 minutes
+			// cleanup ZIP file after cfg.CleanupTTLSeconds
 			go func(f string) {
-				time.Sleep(5 * time.Minute)
+				time.Sleep(time.Duration(cfg.CleanupTTLSeconds) * time.Second)
 				if err := os.Remove(f); err != nil {
 					log.Printf("[-] Error cleaning up ZIP file %s: %v", f, err)
 				}
@@ -240,13 +518,19 @@ func processURLs(urls []string, ch chan string) {
 		}
 	}
 
-	ch <- "event: done\ndata: {}\n\n"
+	emit(sessionID, ch, "event: done\ndata: {}\n\n")
 	close(ch)
+	sessionCancels.Delete(sessionID)
+
+	if err := store.CompleteJob(sessionID); err != nil {
+		log.Printf("[-] Error completing job %s: %v", sessionID, err)
+	}
 
-	// cleanup audio files after 5 minutes -> adjust as needed
-	for _, f := range filenames {
+	// cleanup freshly-downloaded audio files after cfg.CleanupTTLSeconds.
+	// Files reused from a prior completed track are left alone so dedup keeps working.
+	for _, f := range freshFilenames {
 		go func(f string) {
-			time.Sleep(5 * time.Minute)
+			time.Sleep(time.Duration(cfg.CleanupTTLSeconds) * time.Second)
 			if err := os.Remove(f); err != nil {
 				log.Printf("[-] Error cleaning up file %s: %v", f, err)
 			}
@@ -255,10 +539,48 @@ func processURLs(urls []string, ch chan string) {
 }
 
 func main() {
+	configPath := flag.String("config", "conf.json", "path to config file")
+	flag.Parse()
+
+	var err error
+	cfg, err = loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("[-] Error loading config: %v", err)
+	}
+
+	if cfg.WorkDir != "" && cfg.WorkDir != "." {
+		if err := os.MkdirAll(cfg.WorkDir, 0o755); err != nil {
+			log.Fatalf("[-] Error creating work dir %s: %v", cfg.WorkDir, err)
+		}
+		if err := os.Chdir(cfg.WorkDir); err != nil {
+			log.Fatalf("[-] Error changing to work dir %s: %v", cfg.WorkDir, err)
+		}
+	}
+
 	ytdlp.MustInstall(context.TODO(), nil)
 
+	store, err = openStore("gomp3.db")
+	if err != nil {
+		log.Fatalf("[-] Error opening store: %v", err)
+	}
+
+	tokenSecret, err = loadTokenSecret(cfg)
+	if err != nil {
+		log.Fatalf("[-] Error loading token secret: %v", err)
+	}
+
+	if bucket := os.Getenv("GOMP3_S3_BUCKET"); bucket != "" {
+		s3, err := newS3Storage(context.TODO(), bucket)
+		if err != nil {
+			log.Fatalf("[-] Error initializing S3 storage: %v", err)
+		}
+		objectStorage = s3
+		s3Backend = s3
+		log.Printf("Using S3 storage backend (bucket=%s)", bucket)
+	}
+
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:4444")
+		w.Header().Set("Access-Control-Allow-Origin", cfg.CORSOrigin)
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
@@ -278,7 +600,7 @@ func main() {
 	})
 
 	http.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:4444")
+		w.Header().Set("Access-Control-Allow-Origin", cfg.CORSOrigin)
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
@@ -296,12 +618,91 @@ func main() {
 			http.Error(w, "invalid request: URLs required", http.StatusBadRequest)
 			return
 		}
+		if len(req.URLs) > cfg.MaxURLsPerRequest {
+			http.Error(w, fmt.Sprintf("too many URLs: max %d per request", cfg.MaxURLsPerRequest), http.StatusBadRequest)
+			return
+		}
+
+		format, err := lookupFormat(req.Format)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		maxDownloads := 0
+		if v := r.URL.Query().Get("max-downloads"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid max-downloads", http.StatusBadRequest)
+				return
+			}
+			maxDownloads = n
+		}
 
 		sessionID := generateUniqueID()
+		if err := store.CreateJob(sessionID); err != nil {
+			http.Error(w, "error creating job", http.StatusInternalServerError)
+			log.Printf("[-] Error creating job %s: %v", sessionID, err)
+			return
+		}
 		ch := make(chan string)
-		sessions.Store(sessionID, ch)
+		liveSessions.Store(sessionID, ch)
 
-		go processURLs(req.URLs, ch)
+		jobCtx, cancel := context.WithCancel(context.Background())
+		sessionCancels.Store(sessionID, cancel)
+
+		go processURLs(jobCtx, req.URLs, format, req.Quality, req.Bitrate, sessionID, ch, maxDownloads)
+
+		response := SessionResponse{SessionID: sessionID}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Printf("[-] Error encoding response: %v", err)
+		}
+	})
+
+	http.HandleFunc("/clip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", cfg.CORSOrigin)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req ClipRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == "" {
+			http.Error(w, "invalid request: url required", http.StatusBadRequest)
+			return
+		}
+		if req.EndMs <= req.StartMs {
+			http.Error(w, "invalid request: endMs must be greater than startMs", http.StatusBadRequest)
+			return
+		}
+
+		format, err := lookupFormat(req.Format)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sessionID := generateUniqueID()
+		if err := store.CreateJob(sessionID); err != nil {
+			http.Error(w, "error creating job", http.StatusInternalServerError)
+			log.Printf("[-] Error creating job %s: %v", sessionID, err)
+			return
+		}
+		ch := make(chan string)
+		liveSessions.Store(sessionID, ch)
+
+		clipCtx, cancel := context.WithCancel(context.Background())
+		sessionCancels.Store(sessionID, cancel)
+
+		go processClip(clipCtx, req.URL, req.StartMs, req.EndMs, format, sessionID, ch)
 
 		response := SessionResponse{SessionID: sessionID}
 		w.Header().Set("Content-Type", "application/json")
@@ -311,8 +712,8 @@ func main() {
 	})
 
 	http.HandleFunc("/progress/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:4444")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Origin", cfg.CORSOrigin)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, DELETE, OPTIONS")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -321,12 +722,27 @@ func main() {
 		parts := strings.Split(r.URL.Path, "/")
 		sessionID := parts[len(parts)-1]
 
-		v, ok := sessions.Load(sessionID)
-		if !ok {
+		if r.Method == http.MethodDelete {
+			v, ok := sessionCancels.Load(sessionID)
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			v.(context.CancelFunc)()
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		job, err := store.GetJob(sessionID)
+		if err != nil {
+			http.Error(w, "error looking up job", http.StatusInternalServerError)
+			log.Printf("[-] Error looking up job %s: %v", sessionID, err)
+			return
+		}
+		if job == nil {
 			http.NotFound(w, r)
 			return
 		}
-		ch := v.(chan string)
 
 		flusher, ok := w.(http.Flusher)
 		if !ok {
@@ -338,14 +754,81 @@ func main() {
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
 
-		for msg := range ch {
+		// replay history first, in case this is a reconnect
+		events, err := store.EventsForSession(sessionID)
+		if err != nil {
+			log.Printf("[-] Error replaying events for session %s: %v", sessionID, err)
+		}
+		for _, msg := range events {
 			fmt.Fprint(w, msg)
-			flusher.Flush()
 		}
+		flusher.Flush()
+
+		// then tail the live channel, if the job is still running
+		if v, ok := liveSessions.Load(sessionID); ok {
+			ch := v.(chan string)
+			for msg := range ch {
+				fmt.Fprint(w, msg)
+				flusher.Flush()
+			}
+			liveSessions.Delete(sessionID)
+		}
+	})
+
+	http.HandleFunc("/file/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", cfg.CORSOrigin)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		token := strings.TrimPrefix(r.URL.Path, "/file/")
+		payload, err := verifyDownloadToken(token)
+		if err != nil {
+			http.Error(w, "invalid or expired download link", http.StatusForbidden)
+			return
+		}
+
+		track, err := store.GetTrack(payload.TrackID)
+		if err != nil {
+			http.Error(w, "error looking up track", http.StatusInternalServerError)
+			log.Printf("[-] Error looking up track %s: %v", payload.TrackID, err)
+			return
+		}
+		if track == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		file, err := os.Open(track.FilePath)
+		if err != nil {
+			http.Error(w, "error opening file", http.StatusInternalServerError)
+			log.Printf("[-] Error opening file %s: %v", track.FilePath, err)
+			return
+		}
+		defer file.Close()
 
-		sessions.Delete(sessionID)
+		var displayName, contentType string
+		if track.Format == "zip" {
+			displayName = fmt.Sprintf("%s.zip", track.Title)
+			contentType = "application/zip"
+		} else {
+			format, err := lookupFormat(track.Format)
+			if err != nil {
+				format = Format{Extension: "bin", ContentType: "application/octet-stream"}
+			}
+			displayName = fmt.Sprintf("%s - %s.%s", track.Extractor, track.Title, format.Extension)
+			contentType = format.ContentType
+		}
+
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", displayName))
+		w.Header().Set("Content-Type", contentType)
+		if _, err := io.Copy(w, file); err != nil {
+			log.Printf("[-] Error streaming file %s: %v", track.FilePath, err)
+		}
 	})
 
-	log.Println("Server running at http://localhost:4444")
-	log.Fatal(http.ListenAndServe("0.0.0.0:4444", nil))
+	log.Printf("Server running at %s", cfg.BindAddr)
+	log.Fatal(http.ListenAndServe(cfg.BindAddr, nil))
 }
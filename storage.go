@@ -0,0 +1,169 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// defaultPresignTTL is how long a presigned S3 download link stays valid.
+const defaultPresignTTL = 1 * time.Hour
+
+// Storage abstracts where completed track/zip files live, so GoMP3 can run against
+// local disk (default, current behavior) or an S3-compatible bucket to let multiple
+// instances share completed downloads behind a load balancer.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	PresignedGetURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// localStorage keeps the original behavior: files live on local disk and are served
+// directly by the /file/{token} handler.
+type localStorage struct{}
+
+func newLocalStorage() *localStorage { return &localStorage{} }
+
+func (localStorage) Put(_ context.Context, key string, r io.Reader) error {
+	f, err := os.Create(key)
+	if err != nil {
+		return fmt.Errorf("error creating local file %s: %w", key, err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("error writing local file %s: %w", key, err)
+	}
+	return nil
+}
+
+func (localStorage) PresignedGetURL(_ context.Context, key string, _ time.Duration) (string, error) {
+	return key, nil
+}
+
+func (localStorage) Delete(_ context.Context, key string) error {
+	return os.Remove(key)
+}
+
+// s3Storage stores files in an S3-compatible bucket, using multipart uploads for
+// large files and presigned URLs in place of serving bytes through this process.
+type s3Storage struct {
+	client  *s3.Client
+	bucket  string
+	presign *s3.PresignClient
+}
+
+// newS3Storage builds an s3Storage for bucket using the default AWS credential chain
+// (env vars, shared config, instance role, etc).
+func newS3Storage(ctx context.Context, bucket string) (*s3Storage, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading AWS config: %w", err)
+	}
+	client := s3.NewFromConfig(cfg)
+	return &s3Storage{client: client, bucket: bucket, presign: s3.NewPresignClient(client)}, nil
+}
+
+func (s *s3Storage) Put(ctx context.Context, key string, r io.Reader) error {
+	uploader := manager.NewUploader(s.client)
+	if _, err := uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	}); err != nil {
+		return fmt.Errorf("error uploading %s to S3: %w", key, err)
+	}
+	return nil
+}
+
+func (s *s3Storage) PresignedGetURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = defaultPresignTTL
+	}
+	req, err := s.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("error presigning %s: %w", key, err)
+	}
+	return req.URL, nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	if _, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return fmt.Errorf("error deleting %s from S3: %w", key, err)
+	}
+	return nil
+}
+
+// zipToS3 streams each key's bytes straight out of S3 into a zip.Writer that feeds a
+// second multipart upload, so building the archive never touches local disk.
+func (s *s3Storage) zipToS3(ctx context.Context, keys []string, zipKey string) error {
+	pr, pw := io.Pipe()
+
+	zipErrCh := make(chan error, 1)
+	go func() {
+		// pw must be closed WITH the failing error on any error path, not a plain
+		// Close(): a plain close looks like clean EOF to the uploader reading pr,
+		// which would then happily finish uploading a truncated zip under zipKey.
+		var zipErr error
+		defer func() { pw.CloseWithError(zipErr) }()
+
+		zw := zip.NewWriter(pw)
+		for _, key := range keys {
+			obj, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+			if err != nil {
+				zipErr = fmt.Errorf("error fetching %s from S3: %w", key, err)
+				zipErrCh <- zipErr
+				return
+			}
+			w, err := zw.Create(filepath.Base(key))
+			if err != nil {
+				obj.Body.Close()
+				zipErr = fmt.Errorf("error adding %s to zip: %w", key, err)
+				zipErrCh <- zipErr
+				return
+			}
+			_, copyErr := io.Copy(w, obj.Body)
+			obj.Body.Close()
+			if copyErr != nil {
+				zipErr = fmt.Errorf("error streaming %s into zip: %w", key, copyErr)
+				zipErrCh <- zipErr
+				return
+			}
+		}
+		if err := zw.Close(); err != nil {
+			zipErr = fmt.Errorf("error closing zip writer: %w", err)
+			zipErrCh <- zipErr
+			return
+		}
+		zipErrCh <- nil
+	}()
+
+	uploader := manager.NewUploader(s.client)
+	_, uploadErr := uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(zipKey),
+		Body:   pr,
+	})
+
+	if zipErr := <-zipErrCh; zipErr != nil {
+		return zipErr
+	}
+	if uploadErr != nil {
+		return fmt.Errorf("error uploading zip to S3: %w", uploadErr)
+	}
+	return nil
+}
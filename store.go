@@ -0,0 +1,230 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Job is a single /download (or /clip) request, identified by its session ID.
+type Job struct {
+	SessionID string
+	CreatedAt time.Time
+	Status    string
+}
+
+// Track is one downloaded/clipped file belonging to a Job.
+type Track struct {
+	ID          string
+	JobID       string
+	SourceURL   string
+	Extractor   string
+	SourceID    string
+	Title       string
+	Thumbnail   string
+	Format      string
+	FilePath    string // local path, or the object storage key when Backend is "s3"
+	Backend     string // "local" or "s3"
+	SizeBytes   int64
+	DurationMs  int64
+	Status      string
+	CompletedAt time.Time
+}
+
+// Store persists jobs, tracks and their SSE event history so progress can survive a
+// client reconnect and completed downloads can be deduplicated across sessions.
+type Store struct {
+	db *sql.DB
+}
+
+// openStore opens (creating if necessary) the SQLite database at path and runs migrations.
+func openStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening store: %w", err)
+	}
+	s := &Store{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) migrate() error {
+	_, err := s.db.Exec(`
+CREATE TABLE IF NOT EXISTS jobs (
+	session_id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	status TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS tracks (
+	id TEXT PRIMARY KEY,
+	job_id TEXT NOT NULL,
+	source_url TEXT NOT NULL,
+	extractor TEXT NOT NULL,
+	source_id TEXT NOT NULL,
+	title TEXT NOT NULL,
+	thumbnail TEXT,
+	format TEXT NOT NULL,
+	file_path TEXT NOT NULL,
+	backend TEXT NOT NULL DEFAULT 'local',
+	size_bytes INTEGER NOT NULL DEFAULT 0,
+	duration_ms INTEGER NOT NULL DEFAULT 0,
+	status TEXT NOT NULL,
+	completed_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_tracks_source ON tracks(extractor, source_id, format, status);
+CREATE TABLE IF NOT EXISTS events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_events_session ON events(session_id, id);
+CREATE TABLE IF NOT EXISTS download_tokens (
+	id TEXT PRIMARY KEY,
+	remaining INTEGER NOT NULL
+);
+`)
+	if err != nil {
+		return fmt.Errorf("error migrating store: %w", err)
+	}
+	return nil
+}
+
+// CreateJob records a new job row for sessionID.
+func (s *Store) CreateJob(sessionID string) error {
+	if _, err := s.db.Exec(`INSERT INTO jobs (session_id, created_at, status) VALUES (?, ?, ?)`,
+		sessionID, time.Now(), "running"); err != nil {
+		return fmt.Errorf("error creating job: %w", err)
+	}
+	return nil
+}
+
+// GetJob fetches a job by session ID, used to validate /progress reconnects.
+func (s *Store) GetJob(sessionID string) (*Job, error) {
+	row := s.db.QueryRow(`SELECT session_id, created_at, status FROM jobs WHERE session_id = ?`, sessionID)
+	var j Job
+	if err := row.Scan(&j.SessionID, &j.CreatedAt, &j.Status); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error looking up job: %w", err)
+	}
+	return &j, nil
+}
+
+// CompleteJob marks a job as finished once all its tracks have been processed.
+func (s *Store) CompleteJob(sessionID string) error {
+	if _, err := s.db.Exec(`UPDATE jobs SET status = 'done' WHERE session_id = ?`, sessionID); err != nil {
+		return fmt.Errorf("error completing job: %w", err)
+	}
+	return nil
+}
+
+// FindCompletedTrack looks up a previously completed track for the same source and
+// output format, so processURLs can skip re-downloading when the file is already on
+// disk. A track downloaded as mp3 is not a cache hit for a flac request.
+func (s *Store) FindCompletedTrack(extractor, sourceID, format string) (*Track, error) {
+	row := s.db.QueryRow(`SELECT id, job_id, source_url, extractor, source_id, title, thumbnail,
+		format, file_path, backend, size_bytes, duration_ms, status FROM tracks
+		WHERE extractor = ? AND source_id = ? AND format = ? AND status = 'completed'
+		ORDER BY completed_at DESC LIMIT 1`, extractor, sourceID, format)
+
+	var t Track
+	if err := row.Scan(&t.ID, &t.JobID, &t.SourceURL, &t.Extractor, &t.SourceID, &t.Title,
+		&t.Thumbnail, &t.Format, &t.FilePath, &t.Backend, &t.SizeBytes, &t.DurationMs, &t.Status); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error looking up track: %w", err)
+	}
+	return &t, nil
+}
+
+// InsertTrack records a completed track.
+func (s *Store) InsertTrack(t Track) error {
+	if t.Backend == "" {
+		t.Backend = "local"
+	}
+	if _, err := s.db.Exec(`INSERT INTO tracks (id, job_id, source_url, extractor, source_id,
+		title, thumbnail, format, file_path, backend, size_bytes, duration_ms, status, completed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, t.JobID, t.SourceURL, t.Extractor, t.SourceID, t.Title, t.Thumbnail, t.Format,
+		t.FilePath, t.Backend, t.SizeBytes, t.DurationMs, "completed", time.Now()); err != nil {
+		return fmt.Errorf("error inserting track: %w", err)
+	}
+	return nil
+}
+
+// GetTrack fetches a single track by ID, used by the /file/{token} handler.
+func (s *Store) GetTrack(id string) (*Track, error) {
+	row := s.db.QueryRow(`SELECT id, job_id, source_url, extractor, source_id, title, thumbnail,
+		format, file_path, backend, size_bytes, duration_ms, status FROM tracks WHERE id = ?`, id)
+
+	var t Track
+	if err := row.Scan(&t.ID, &t.JobID, &t.SourceURL, &t.Extractor, &t.SourceID, &t.Title,
+		&t.Thumbnail, &t.Format, &t.FilePath, &t.Backend, &t.SizeBytes, &t.DurationMs, &t.Status); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error looking up track: %w", err)
+	}
+	return &t, nil
+}
+
+// AppendEvent persists an SSE payload so it can be replayed to a reconnecting client.
+func (s *Store) AppendEvent(sessionID, payload string) error {
+	if _, err := s.db.Exec(`INSERT INTO events (session_id, payload, created_at) VALUES (?, ?, ?)`,
+		sessionID, payload, time.Now()); err != nil {
+		return fmt.Errorf("error recording event: %w", err)
+	}
+	return nil
+}
+
+// CreateDownloadToken records a download counter for a newly issued token, good for
+// maxDownloads uses.
+func (s *Store) CreateDownloadToken(id string, maxDownloads int) error {
+	if _, err := s.db.Exec(`INSERT INTO download_tokens (id, remaining) VALUES (?, ?)`,
+		id, maxDownloads); err != nil {
+		return fmt.Errorf("error creating download token: %w", err)
+	}
+	return nil
+}
+
+// ConsumeDownloadToken atomically decrements a token's remaining-download counter and
+// reports whether the consuming request was within its limit.
+func (s *Store) ConsumeDownloadToken(id string) (bool, error) {
+	res, err := s.db.Exec(`UPDATE download_tokens SET remaining = remaining - 1 WHERE id = ? AND remaining > 0`, id)
+	if err != nil {
+		return false, fmt.Errorf("error consuming download token: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking download token update: %w", err)
+	}
+	return n > 0, nil
+}
+
+// EventsForSession returns every event recorded for sessionID, oldest first, so a
+// reconnecting /progress client can replay history before the live channel tails in.
+func (s *Store) EventsForSession(sessionID string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT payload FROM events WHERE session_id = ? ORDER BY id ASC`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []string
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, fmt.Errorf("error scanning event: %w", err)
+		}
+		events = append(events, payload)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// defaultTokenTTL is how long a signed download link stays valid.
+const defaultTokenTTL = 1 * time.Hour
+
+// tokenSecret signs every download token issued by this process. It's loaded from
+// cfg.TokenSecret at startup, or generated fresh if the config doesn't set one (in
+// which case tokens stop validating across restarts, which is fine for dev use).
+var tokenSecret []byte
+
+// downloadTokenPayload is the signed contents of a /file/{token} download link.
+type downloadTokenPayload struct {
+	ID           string `json:"id"`
+	TrackID      string `json:"trackID"`
+	Exp          int64  `json:"exp"`
+	MaxDownloads int    `json:"maxDownloads"`
+}
+
+// loadTokenSecret resolves the signing secret: cfg.TokenSecret (hex-encoded) if set,
+// otherwise a freshly generated random secret good for this process's lifetime.
+func loadTokenSecret(cfg Config) ([]byte, error) {
+	if cfg.TokenSecret != "" {
+		secret, err := hex.DecodeString(cfg.TokenSecret)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding tokenSecret: %w", err)
+		}
+		return secret, nil
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("error generating token secret: %w", err)
+	}
+	log.Println("[!] No tokenSecret configured; generated an ephemeral one for this run (download links won't survive a restart)")
+	return secret, nil
+}
+
+// issueDownloadToken signs a download link for trackID, valid for ttl and usable up to
+// maxDownloads times (0 means unlimited).
+func issueDownloadToken(trackID string, ttl time.Duration, maxDownloads int) (string, error) {
+	payload := downloadTokenPayload{
+		ID:           generateUniqueID(),
+		TrackID:      trackID,
+		Exp:          time.Now().Add(ttl).Unix(),
+		MaxDownloads: maxDownloads,
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling token payload: %w", err)
+	}
+
+	if maxDownloads > 0 {
+		if err := store.CreateDownloadToken(payload.ID, maxDownloads); err != nil {
+			return "", err
+		}
+	}
+
+	mac := hmac.New(sha256.New, tokenSecret)
+	mac.Write(data)
+
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifyDownloadToken checks token's signature and expiry, then atomically consumes
+// one use against its download counter, if it has one.
+func verifyDownloadToken(token string) (downloadTokenPayload, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return downloadTokenPayload{}, fmt.Errorf("malformed token")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return downloadTokenPayload{}, fmt.Errorf("malformed token payload")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return downloadTokenPayload{}, fmt.Errorf("malformed token signature")
+	}
+
+	mac := hmac.New(sha256.New, tokenSecret)
+	mac.Write(data)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return downloadTokenPayload{}, fmt.Errorf("invalid token signature")
+	}
+
+	var payload downloadTokenPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return downloadTokenPayload{}, fmt.Errorf("malformed token payload")
+	}
+	if time.Now().Unix() > payload.Exp {
+		return downloadTokenPayload{}, fmt.Errorf("token expired")
+	}
+
+	if payload.MaxDownloads > 0 {
+		ok, err := store.ConsumeDownloadToken(payload.ID)
+		if err != nil {
+			return downloadTokenPayload{}, err
+		}
+		if !ok {
+			return downloadTokenPayload{}, fmt.Errorf("download limit reached")
+		}
+	}
+
+	return payload, nil
+}
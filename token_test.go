@@ -0,0 +1,103 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupTokenTest points the package-level store and tokenSecret at a fresh temporary
+// SQLite file and a fixed secret, so token tests don't depend on main()'s startup path.
+func setupTokenTest(t *testing.T) {
+	t.Helper()
+	s, err := openStore(filepath.Join(t.TempDir(), "tokens.db"))
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	t.Cleanup(func() { s.db.Close() })
+
+	prevStore, prevSecret := store, tokenSecret
+	store = s
+	tokenSecret = []byte("test-secret-test-secret-test-se")
+	t.Cleanup(func() { store, tokenSecret = prevStore, prevSecret })
+}
+
+func TestIssueAndVerifyDownloadToken_RoundTrip(t *testing.T) {
+	setupTokenTest(t)
+
+	token, err := issueDownloadToken("track-123", time.Hour, 0)
+	if err != nil {
+		t.Fatalf("issueDownloadToken: %v", err)
+	}
+
+	payload, err := verifyDownloadToken(token)
+	if err != nil {
+		t.Fatalf("verifyDownloadToken: %v", err)
+	}
+	if payload.TrackID != "track-123" {
+		t.Errorf("TrackID = %q, want %q", payload.TrackID, "track-123")
+	}
+}
+
+func TestVerifyDownloadToken_TamperedSignatureRejected(t *testing.T) {
+	setupTokenTest(t)
+
+	token, err := issueDownloadToken("track-123", time.Hour, 0)
+	if err != nil {
+		t.Fatalf("issueDownloadToken: %v", err)
+	}
+
+	// Change the first signature character: all six of its bits are signature data,
+	// unlike the last one's, so the decoded signature is sure to differ.
+	sigStart := strings.LastIndex(token, ".") + 1
+	replacement := "A"
+	if token[sigStart] == 'A' {
+		replacement = "B"
+	}
+	tampered := token[:sigStart] + replacement + token[sigStart+1:]
+
+	if _, err := verifyDownloadToken(tampered); err == nil {
+		t.Fatal("verifyDownloadToken(tampered): want error, got nil")
+	}
+}
+
+func TestVerifyDownloadToken_MalformedRejected(t *testing.T) {
+	setupTokenTest(t)
+
+	if _, err := verifyDownloadToken("not-a-valid-token"); err == nil {
+		t.Fatal("verifyDownloadToken(malformed): want error, got nil")
+	}
+}
+
+func TestVerifyDownloadToken_ExpiredRejected(t *testing.T) {
+	setupTokenTest(t)
+
+	token, err := issueDownloadToken("track-123", -time.Minute, 0)
+	if err != nil {
+		t.Fatalf("issueDownloadToken: %v", err)
+	}
+
+	if _, err := verifyDownloadToken(token); err == nil {
+		t.Fatal("verifyDownloadToken(expired): want error, got nil")
+	}
+}
+
+func TestVerifyDownloadToken_MaxDownloadsExhausted(t *testing.T) {
+	setupTokenTest(t)
+
+	token, err := issueDownloadToken("track-123", time.Hour, 2)
+	if err != nil {
+		t.Fatalf("issueDownloadToken: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := verifyDownloadToken(token); err != nil {
+			t.Fatalf("verifyDownloadToken use %d: %v", i+1, err)
+		}
+	}
+
+	if _, err := verifyDownloadToken(token); err == nil {
+		t.Fatal("verifyDownloadToken past maxDownloads: want error, got nil")
+	}
+}